@@ -2,19 +2,21 @@ package v1
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/NJUPT-SAST/sast-link-backend/apierror"
 	"github.com/NJUPT-SAST/sast-link-backend/config"
 	"github.com/NJUPT-SAST/sast-link-backend/model"
 	"github.com/NJUPT-SAST/sast-link-backend/model/result"
+	"github.com/NJUPT-SAST/sast-link-backend/oidc"
 	"github.com/NJUPT-SAST/sast-link-backend/service"
 	"github.com/NJUPT-SAST/sast-link-backend/util"
 	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
 	"github.com/go-oauth2/oauth2/v4/errors"
 	"github.com/go-oauth2/oauth2/v4/manage"
 	"github.com/go-oauth2/oauth2/v4/models"
@@ -31,6 +33,7 @@ var (
 	pgxConn, _     = pgx.Connect(context.TODO(), config.Config.Sub("oauth").GetString("db_uri"))
 	adapter        = pgx4adapter.NewConn(pgxConn)
 	clientStore, _ = pg.NewClientStore(adapter)
+	tokenStore, _  = pg.NewTokenStore(adapter, pg.WithTokenStoreGCInterval(time.Minute))
 )
 
 func init() {
@@ -38,10 +41,6 @@ func init() {
 }
 
 func InitServer() {
-	// use PostgreSQL token store with pgx.Connection adapter
-	tokenStore, _ := pg.NewTokenStore(adapter, pg.WithTokenStoreGCInterval(time.Minute))
-	defer tokenStore.Close()
-
 	mg := manage.NewDefaultManager()
 	mg.MapTokenStorage(tokenStore)
 	mg.SetAuthorizeCodeTokenCfg(manage.DefaultAuthorizeCodeTokenCfg)
@@ -49,18 +48,34 @@ func InitServer() {
 	// use PostgreSQL client store with pgx.Connection adapter
 	mg.MapClientStorage(clientStore)
 
-	srv = server.NewServer(server.NewConfig(), mg)
+	cfg := server.NewConfig()
+	// RFC 7636: S256 is always allowed; "plain" is weaker (the verifier is
+	// sent as-is) so it's opt-in via config for clients that can't do SHA-256.
+	cfg.AllowedCodeChallengeMethods = []oauth2.CodeChallengeMethod{oauth2.CodeChallengeS256}
+	if config.Config.Sub("oauth").GetBool("pkce_allow_plain") {
+		cfg.AllowedCodeChallengeMethods = append(cfg.AllowedCodeChallengeMethods, oauth2.CodeChallengePlain)
+	}
+
+	srv = server.NewServer(cfg, mg)
 	srv.SetClientInfoHandler(clientInfoHandler)
 	srv.SetUserAuthorizationHandler(userAuthorizeHandler)
+	srv.SetExtensionFieldsHandler(idTokenExtensionHandler)
 
-	// TODO: error handler
 	srv.SetInternalErrorHandler(func(err error) (re *errors.Response) {
-		log.Println("Internal Error:", err.Error())
-		error := errors.NewResponse(err, http.StatusInternalServerError)
-		error.ErrorCode = 500
-		error.StatusCode = http.StatusInternalServerError
-		error.Description = err.Error()
-		return error
+		// Errors that are already typed (e.g. the apierror.Client that
+		// clientInfoHandler returns) keep their status; the rest are Internal.
+		apiErr, ok := err.(*apierror.Error)
+		if !ok {
+			apiErr = apierror.Wrap(err, apierror.Internal)
+		}
+		log.Println("Internal Error:", apiErr.Error())
+
+		// Only the sentinel's own message reaches the client, never Cause.
+		response := errors.NewResponse(apierror.Wrap(nil, apiErr), apiErr.HTTPStatus)
+		response.ErrorCode = apiErr.Code
+		response.StatusCode = apiErr.HTTPStatus
+		response.Description = apiErr.Message
+		return response
 	})
 
 	srv.SetResponseErrorHandler(func(re *errors.Response) {
@@ -70,79 +85,120 @@ func InitServer() {
 }
 
 // Create client
-func CreateClient(c *gin.Context) {
+func CreateClient(c *gin.Context) error {
 	redirectURI := c.PostForm("redirect_uri")
 	if redirectURI == "" {
-		c.JSON(http.StatusBadRequest, result.Failed(result.ParamError))
-		return
+		return apierror.ParamError
 	}
 
+	// Public clients (SPAs, mobile apps) can't keep a client_secret
+	// confidential, so they authenticate at the token endpoint with PKCE
+	// instead - see clientInfoHandler.
+	public := c.PostForm("client_type") == "public"
+
 	clientID := util.GenerateUUID()
-	secret, err := util.GenerateRandomString(32)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, result.Failed(result.InternalErr))
-		return
+	var secret string
+	if !public {
+		var err error
+		secret, err = util.GenerateRandomString(32)
+		if err != nil {
+			return apierror.Wrap(err, apierror.Internal)
+		}
 	}
 
-	cErr := clientStore.Create(&models.Client{
+	if err := clientStore.Create(&models.Client{
 		ID:     clientID,
 		Secret: secret,
 		Domain: redirectURI,
-	})
-	if cErr != nil {
-		c.JSON(http.StatusBadRequest, result.Failed(result.InternalErr))
-		return
+		Public: public,
+	}); err != nil {
+		return apierror.Wrap(err, apierror.Internal)
 	}
 
-	c.JSON(http.StatusOK, result.Success(gin.H{
-		"client_id":     clientID,
-		"client_secret": secret,
-	}))
+	resp := gin.H{"client_id": clientID}
+	if !public {
+		resp["client_secret"] = secret
+	}
+	c.JSON(http.StatusOK, result.Success(resp))
+	return nil
 }
 
-func OauthUserInfo(c *gin.Context) {
+func OauthUserInfo(c *gin.Context) error {
 	// Bearer
 	bearerToken := c.GetHeader("Authorization")
 	if bearerToken == "" ||
 		!strings.HasPrefix(bearerToken, "Bearer ") {
-		c.JSON(http.StatusOK, result.Failed(result.AccessTokenErr))
-		return
+		return apierror.AccessToken
 	}
 	accessToken := strings.Split(bearerToken, " ")[1]
 	mg := srv.Manager
 	ti, err := mg.LoadAccessToken(c, accessToken)
 	if err != nil {
-		c.JSON(http.StatusOK, result.Failed(result.AccessTokenErr))
-		return
+		return apierror.Wrap(err, apierror.AccessToken)
 	}
-	// TODO: scope check
-	ti.GetScope()
+	scopes := oidc.ParseScope(ti.GetScope())
 
 	user, err := service.OauthUserInfo(ti.GetUserID())
 	if err != nil {
 		controllerLogger.WithFields(
 			logrus.Fields{
-				"username": user.Uid,
+				"username": ti.GetUserID(),
 			}).Error(err)
-		c.JSON(http.StatusOK, result.Failed(result.GET_USERINFO_FAIL))
-		return
+		return apierror.Wrap(err, apierror.UserInfoFail)
+	}
+
+	c.JSON(http.StatusOK, result.Success(oidc.ClaimsForUser(user, scopes)))
+	return nil
+}
+
+// Discovery serves the OpenID Provider Configuration document at
+// /.well-known/openid-configuration.
+func Discovery(c *gin.Context) error {
+	c.JSON(http.StatusOK, oidc.Discovery())
+	return nil
+}
+
+// JWKS serves the public signing keys at /.well-known/jwks.json so relying
+// parties can verify id_token signatures.
+func JWKS(c *gin.Context) error {
+	jwks, err := oidc.DefaultJWKSStore().JWKS()
+	if err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+	c.JSON(http.StatusOK, jwks)
+	return nil
+}
+
+// idTokenExtensionHandler adds an id_token to the token response whenever
+// the granted scope includes "openid", per OpenID Connect Core 1.0.
+func idTokenExtensionHandler(ti oauth2.TokenInfo) (map[string]interface{}, error) {
+	scopes := oidc.ParseScope(ti.GetScope())
+	if !oidc.HasScope(scopes, "openid") {
+		return nil, nil
+	}
+
+	user, err := service.OauthUserInfo(ti.GetUserID())
+	if err != nil {
+		return nil, nil
 	}
 
-	c.JSON(http.StatusOK, result.Success(gin.H{
-		"email":   user.Email,
-		"user_id": user.Uid,
-	}))
+	idToken, err := oidc.IssueIDToken(user, ti.GetClientID(), scopes, "")
+	if err != nil {
+		controllerLogger.WithFields(logrus.Fields{"client_id": ti.GetClientID()}).Error(err)
+		return nil, nil
+	}
+
+	return map[string]interface{}{"id_token": idToken}, nil
 }
 
-func Authorize(c *gin.Context) {
+func Authorize(c *gin.Context) error {
 	r := c.Request
 	w := c.Writer
 	_ = r.ParseMultipartForm(0)
 	_ = r.ParseForm()
 	store, err := session.Start(c, w, r)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, result.Failed(result.InternalErr.Wrap(err)))
-		return
+		return apierror.Wrap(err, apierror.Internal)
 	}
 	var form url.Values
 	if v, ok := store.Get("ReturnUri"); ok {
@@ -156,51 +212,39 @@ func Authorize(c *gin.Context) {
 
 	// Redirect user to login page if user not login or
 	// Get code directly if user has logged in
-	err = srv.HandleAuthorizeRequest(w, r)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, result.Failed(result.InternalErr.Wrap(err)))
-		return
+	if err := srv.HandleAuthorizeRequest(w, r); err != nil {
+		return apierror.Wrap(err, apierror.Internal)
 	}
+	return nil
 }
 
 // User decides whether to authorize
-func UserAuth(c *gin.Context) {
-	w := c.Writer
+func UserAuth(c *gin.Context) error {
 	r := c.Request
 
 	//token := r.Header.Get("TOKEN")
 	_ = r.ParseMultipartForm(0)
 	token := c.PostForm("token")
 	if token == "" {
-		w.Header().Set("Content-Type", "application/json")
-		response := result.Failed(result.AUTH_ERROR)
-		json, _ := json.Marshal(response)
-		w.Write(json)
-		return
+		return apierror.AuthError
 	}
+	return nil
 }
 
 // Get AccessToken
-func AccessToken(c *gin.Context) {
-	w := c.Writer
-	r := c.Request
-	err := srv.HandleTokenRequest(w, r)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, result.Failed(result.InternalErr.Wrap(err)))
-		return
+func AccessToken(c *gin.Context) error {
+	if err := srv.HandleTokenRequest(c.Writer, c.Request); err != nil {
+		return apierror.Wrap(err, apierror.Internal)
 	}
+	return nil
 }
 
 // Refresh AccessToken
-func RefreshToken(c *gin.Context) {
-	w := c.Writer
-	r := c.Request
-	err := srv.HandleTokenRequest(w, r)
-	if err == nil {
-		c.JSON(http.StatusInternalServerError, result.Failed(result.InternalErr.Wrap(err)))
-		return
+func RefreshToken(c *gin.Context) error {
+	if err := srv.HandleTokenRequest(c.Writer, c.Request); err != nil {
+		return apierror.Wrap(err, apierror.RefreshToken)
 	}
+	return nil
 }
 
 func clientInfoHandler(r *http.Request) (clientID, clientSecret string, err error) {
@@ -209,29 +253,52 @@ func clientInfoHandler(r *http.Request) (clientID, clientSecret string, err erro
 	if r.Form.Get("grant_type") == "refresh_token" {
 		ti, err := srv.Manager.LoadRefreshToken(r.Context(), r.Form.Get("refresh_token"))
 		if err != nil {
-			return "", "", result.RefreshTokenErr
+			return "", "", apierror.Wrap(err, apierror.RefreshToken)
 		}
 		clientID = ti.GetClientID()
 		if clientID == "" {
-			return "", "", result.ClientErr
+			return "", "", apierror.Client
 		}
 		cli, err := srv.Manager.GetClient(r.Context(), clientID)
 		if err != nil {
-			return "", "", result.ClientErr
+			return "", "", apierror.Wrap(err, apierror.Client)
 		}
 		clientSecret = cli.GetSecret()
 		if clientSecret == "" {
-			return "", "", result.ClientErr
+			// Public clients are created with no secret (see CreateClient);
+			// refreshing their tokens can't require one or refresh would be
+			// impossible for exactly the clients PKCE was added for.
+			if !cli.IsPublic() {
+				return "", "", apierror.Client
+			}
+			return clientID, "", nil
 		}
 		return clientID, clientSecret, nil
 	}
 	clientID = r.Form.Get("client_id")
 	if clientID == "" {
-		return "", "", result.ClientErr
+		return "", "", apierror.Client
 	}
 	clientSecret = r.Form.Get("client_secret")
 	if clientSecret == "" {
-		return "", "", result.ClientErr
+		// No secret: only acceptable for a public client presenting a PKCE
+		// code_verifier (RFC 7636 §1) against a code that was actually
+		// issued with a code_challenge. Without that check a public client
+		// could omit code_challenge at /authorize (nothing forces one) and
+		// redeem the code at the token endpoint with no authentication at
+		// all - no secret and no real verifier match.
+		cli, cErr := srv.Manager.GetClient(r.Context(), clientID)
+		if cErr != nil {
+			return "", "", apierror.Wrap(cErr, apierror.Client)
+		}
+		if !cli.IsPublic() || r.Form.Get("code_verifier") == "" {
+			return "", "", apierror.Client
+		}
+		ti, tErr := tokenStore.GetByCode(r.Context(), r.Form.Get("code"))
+		if tErr != nil || ti == nil || ti.GetCodeChallenge() == "" {
+			return "", "", apierror.Client
+		}
+		return clientID, "", nil
 	}
 	return clientID, clientSecret, nil
 
@@ -256,10 +323,7 @@ func userAuthorizeHandler(w http.ResponseWriter, r *http.Request) (userID string
 		session.Set("ReturnUri", r.Form)
 		_ = session.Save()
 
-		w.Header().Set("Content-Type", "application/json")
-		response := result.Failed(result.AUTH_ERROR)
-		json, _ := json.Marshal(response)
-		w.Write(json)
+		apierror.RenderHTTP(w, apierror.AuthError)
 		return
 	}
 
@@ -272,10 +336,7 @@ func userAuthorizeHandler(w http.ResponseWriter, r *http.Request) (userID string
 		session.Set("ReturnUri", r.Form)
 		_ = session.Save()
 
-		w.Header().Set("Content-Type", "application/json")
-		response := result.Failed(result.AUTH_ERROR)
-		json, _ := json.Marshal(response)
-		w.Write(json)
+		apierror.RenderHTTP(w, apierror.AuthError)
 		return
 	}
 
@@ -288,10 +349,7 @@ func userAuthorizeHandler(w http.ResponseWriter, r *http.Request) (userID string
 		session.Set("ReturnUri", r.Form)
 		_ = session.Save()
 
-		w.Header().Set("Content-Type", "application/json")
-		response := result.Failed(result.AUTH_ERROR)
-		json, _ := json.Marshal(response)
-		w.Write(json)
+		apierror.RenderHTTP(w, apierror.AuthError)
 		return
 	}
 	if rToken != token {
@@ -302,11 +360,26 @@ func userAuthorizeHandler(w http.ResponseWriter, r *http.Request) (userID string
 		session.Set("ReturnUri", r.Form)
 		_ = session.Save()
 
-		w.Header().Set("Content-Type", "application/json")
-		response := result.Failed(result.AUTH_ERROR)
-		json, _ := json.Marshal(response)
-		w.Write(json)
+		apierror.RenderHTTP(w, apierror.AuthError)
 		return
 	}
+
+	totpEnabled, err := model.HasTOTPEnabled(username)
+	if err != nil {
+		return
+	}
+	if totpEnabled {
+		passed, pErr := model.Rdb.Del(r.Context(), model.OtpPassedKey(username)).Result()
+		if pErr != nil || passed == 0 {
+			// Not yet verified this round - stash the authorize request and
+			// make the frontend redeem a code via /api/v1/oauth/otp_verify.
+			session.Set("PendingAuthorize", r.Form)
+			_ = session.Save()
+
+			apierror.RenderHTTP(w, apierror.OtpRequired)
+			return "", nil
+		}
+	}
+
 	return username, nil
 }
@@ -0,0 +1,190 @@
+package v1
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/NJUPT-SAST/sast-link-backend/apierror"
+	"github.com/NJUPT-SAST/sast-link-backend/model"
+	"github.com/NJUPT-SAST/sast-link-backend/model/result"
+	"github.com/NJUPT-SAST/sast-link-backend/otp"
+	"github.com/NJUPT-SAST/sast-link-backend/util"
+	"github.com/gin-gonic/gin"
+	"github.com/go-session/session"
+)
+
+// OtpEnroll starts TOTP enrollment: it generates a new secret, stores it
+// encrypted (unconfirmed) against the signed-in user, and returns the
+// otpauth:// URI plus a QR code so an authenticator app can scan it.
+func OtpEnroll(c *gin.Context) error {
+	username, err := util.GetUsername(c.GetHeader("TOKEN"))
+	if err != nil || username == "" {
+		return apierror.AuthError
+	}
+
+	// A confirmed secret must be disabled first; SetTOTPSecret keeps
+	// totp_confirmed_at, so overwriting it would make the new secret live.
+	enabled, err := model.HasTOTPEnabled(username)
+	if err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+	if enabled {
+		return apierror.Wrap(errors.New("otp: totp already enabled"), apierror.ParamError)
+	}
+
+	key, err := otp.GenerateSecret(username)
+	if err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+
+	encrypted, err := otp.Encrypt(key.Secret())
+	if err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+	if err := model.SetTOTPSecret(username, encrypted); err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+
+	qr, err := otp.QRCode(key)
+	if err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+
+	c.JSON(http.StatusOK, result.Success(gin.H{
+		"otpauth_uri": key.URL(),
+		"qr_code_png": base64.StdEncoding.EncodeToString(qr),
+	}))
+	return nil
+}
+
+// OtpConfirm completes enrollment: the user proves they scanned the QR by
+// submitting one valid code, after which TOTP is required on login.
+func OtpConfirm(c *gin.Context) error {
+	username, err := util.GetUsername(c.GetHeader("TOKEN"))
+	if err != nil || username == "" {
+		return apierror.AuthError
+	}
+
+	if !verifyTOTPCode(username, c.PostForm("code")) {
+		return apierror.OtpInvalid
+	}
+
+	if err := model.ConfirmTOTP(username); err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+
+	codes, err := model.GenerateRecoveryCodes(username, 10)
+	if err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+
+	c.JSON(http.StatusOK, result.Success(gin.H{"recovery_codes": codes}))
+	return nil
+}
+
+// OtpDisable turns second-factor login back off for the signed-in user.
+func OtpDisable(c *gin.Context) error {
+	username, err := util.GetUsername(c.GetHeader("TOKEN"))
+	if err != nil || username == "" {
+		return apierror.AuthError
+	}
+
+	if !verifyTOTPCode(username, c.PostForm("code")) {
+		return apierror.OtpInvalid
+	}
+
+	if err := model.DisableTOTP(username); err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+
+	c.JSON(http.StatusOK, result.Success(nil))
+	return nil
+}
+
+// OtpRegenerateRecoveryCodes invalidates a user's existing recovery codes
+// and issues a fresh set.
+func OtpRegenerateRecoveryCodes(c *gin.Context) error {
+	username, err := util.GetUsername(c.GetHeader("TOKEN"))
+	if err != nil || username == "" {
+		return apierror.AuthError
+	}
+
+	if !verifyTOTPCode(username, c.PostForm("code")) {
+		return apierror.OtpInvalid
+	}
+
+	codes, err := model.GenerateRecoveryCodes(username, 10)
+	if err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+
+	c.JSON(http.StatusOK, result.Success(gin.H{"recovery_codes": codes}))
+	return nil
+}
+
+// OauthOtpVerify redeems the pending /authorize request userAuthorizeHandler
+// stashed in the session when it returned otp_required, accepting either a
+// live TOTP code or a recovery code, then replays that authorize request.
+func OauthOtpVerify(c *gin.Context) error {
+	w := c.Writer
+	r := c.Request
+
+	store, err := session.Start(c, w, r)
+	if err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+
+	v, ok := store.Get("PendingAuthorize")
+	if !ok {
+		return apierror.ParamError
+	}
+	form, ok := v.(url.Values)
+	if !ok {
+		return apierror.Internal
+	}
+
+	username, err := util.GetUsername(form.Get("token"))
+	if err != nil || username == "" {
+		return apierror.AuthError
+	}
+
+	code := c.PostForm("code")
+	if !verifyTOTPCode(username, code) {
+		consumed, cErr := model.ConsumeRecoveryCode(username, code)
+		if cErr != nil || !consumed {
+			return apierror.OtpInvalid
+		}
+	}
+
+	store.Delete("PendingAuthorize")
+	_ = store.Save()
+
+	// Give userAuthorizeHandler a short window to see this round as
+	// already-verified when the replayed request reaches it below.
+	model.Rdb.Set(r.Context(), model.OtpPassedKey(username), "1", time.Minute*5)
+
+	r.Form = form
+	if err := srv.HandleAuthorizeRequest(w, r); err != nil {
+		return apierror.Wrap(err, apierror.Internal)
+	}
+	return nil
+}
+
+// verifyTOTPCode decrypts username's stored secret and validates code
+// against it.
+func verifyTOTPCode(username string, code string) bool {
+	user, err := model.UserInfo(username)
+	if err != nil || user.TOTPSecret == nil || code == "" {
+		return false
+	}
+
+	secret, err := otp.Decrypt(*user.TOTPSecret)
+	if err != nil {
+		return false
+	}
+
+	return otp.Validate(secret, code)
+}
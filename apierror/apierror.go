@@ -0,0 +1,66 @@
+// Package apierror gives every api/v1 handler one typed error shape, so a
+// single Gin middleware can render HTTP status, body, and headers
+// consistently instead of each handler picking its own by hand.
+package apierror
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Error is a sentinel API error carrying the HTTP status and body a
+// failure should render as. Cause is the underlying error, if any - it's
+// never shown to the client, only logged, but errors.Is/errors.As still
+// see through it via Unwrap.
+type Error struct {
+	HTTPStatus int
+	Code       int
+	Message    string
+	// WWWAuthError is the RFC 6750 §3 "error" value to send in a
+	// WWW-Authenticate: Bearer header. Empty for non-Bearer failures.
+	WWWAuthError string
+	Cause        error
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Cause }
+
+// Wrap returns a copy of kind with Cause set to err, so sentinels stay
+// immutable (safe for concurrent reuse across requests) while
+// errors.Is(got, kind) still matches the copy against kind (see Is).
+func Wrap(err error, kind *Error) *Error {
+	clone := *kind
+	clone.Cause = err
+	return &clone
+}
+
+// Is reports whether target is the sentinel e was copied from, matching
+// on Code, so errors.Is sees a Wrap result as its sentinel kind.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Sentinel errors every handler in api/v1 wraps its failures in. Proper
+// status codes per RFC 7235/7231: 401 for auth, 400 for malformed
+// parameters, 403 for scope, 500 reserved for truly unexpected failures.
+var (
+	ParamError   = &Error{HTTPStatus: http.StatusBadRequest, Code: 1000, Message: "invalid parameter"}
+	AuthError    = &Error{HTTPStatus: http.StatusUnauthorized, Code: 1001, Message: "not authenticated", WWWAuthError: "invalid_request"}
+	AccessToken  = &Error{HTTPStatus: http.StatusUnauthorized, Code: 1002, Message: "invalid or expired access token", WWWAuthError: "invalid_token"}
+	RefreshToken = &Error{HTTPStatus: http.StatusUnauthorized, Code: 1003, Message: "invalid or expired refresh token", WWWAuthError: "invalid_token"}
+	Client       = &Error{HTTPStatus: http.StatusUnauthorized, Code: 1004, Message: "invalid client credentials", WWWAuthError: "invalid_client"}
+	Scope        = &Error{HTTPStatus: http.StatusForbidden, Code: 1005, Message: "insufficient scope", WWWAuthError: "insufficient_scope"}
+	UserNotExist = &Error{HTTPStatus: http.StatusNotFound, Code: 1006, Message: "user does not exist"}
+	OtpRequired  = &Error{HTTPStatus: http.StatusPreconditionRequired, Code: 1007, Message: "otp verification required"}
+	OtpInvalid   = &Error{HTTPStatus: http.StatusUnauthorized, Code: 1008, Message: "invalid otp or recovery code"}
+	UserInfoFail = &Error{HTTPStatus: http.StatusInternalServerError, Code: 1009, Message: "failed to load user info"}
+	Internal     = &Error{HTTPStatus: http.StatusInternalServerError, Code: 1010, Message: "internal error"}
+	Conflict     = &Error{HTTPStatus: http.StatusConflict, Code: 1011, Message: "already linked to another account"}
+)
@@ -0,0 +1,61 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandlerFunc is a Gin handler that reports failure by returning an error
+// (ideally one built with Wrap) instead of writing its own JSON body.
+type HandlerFunc func(c *gin.Context) error
+
+// Handle adapts a HandlerFunc into a gin.HandlerFunc, rendering any
+// returned error through Render.
+func Handle(fn HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := fn(c); err != nil {
+			Render(c, err)
+		}
+	}
+}
+
+// Render writes err as the uniform {"code", "msg"} body every api/v1
+// handler now shares. Errors that aren't already an *Error are wrapped as
+// Internal so a raw error string is never leaked to the client.
+func Render(c *gin.Context, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = Wrap(err, Internal)
+	}
+
+	if apiErr.WWWAuthError != "" {
+		c.Header("WWW-Authenticate", fmt.Sprintf("Bearer error=%q", apiErr.WWWAuthError))
+	}
+	c.JSON(apiErr.HTTPStatus, gin.H{
+		"code": apiErr.Code,
+		"msg":  apiErr.Message,
+	})
+}
+
+// RenderHTTP is Render's counterpart for code that only has a raw
+// http.ResponseWriter to work with (userAuthorizeHandler, which the
+// go-oauth2/oauth2 server calls), and writes the same body Render does.
+// Errors the go-oauth2/oauth2 server renders itself, through the error
+// handlers registered in InitServer, keep that library's own JSON shape
+// rather than this {"code", "msg"} body.
+func RenderHTTP(w http.ResponseWriter, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = Wrap(err, Internal)
+	}
+
+	if apiErr.WWWAuthError != "" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q", apiErr.WWWAuthError))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.HTTPStatus)
+	fmt.Fprintf(w, `{"code":%d,"msg":%q}`, apiErr.Code, apiErr.Message)
+}
@@ -0,0 +1,38 @@
+package providers
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+	githuboauth "golang.org/x/oauth2/github"
+)
+
+type githubUserInfo struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+}
+
+func newGithubProvider(conf *viper.Viper) IdentityProvider {
+	return &oauth2Provider{
+		name: "github",
+		conf: &oauth2.Config{
+			ClientID:     conf.GetString("client_id"),
+			ClientSecret: conf.GetString("client_secret"),
+			RedirectURL:  conf.GetString("redirect_uri"),
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint:     githuboauth.Endpoint,
+		},
+		userInfoURL: "https://api.github.com/user",
+		parse: func(body []byte) (*RemoteIdentity, error) {
+			var info githubUserInfo
+			if err := decodeJSON(body, &info); err != nil {
+				return nil, err
+			}
+			return &RemoteIdentity{
+				Subject: fmt.Sprintf("%d", info.ID),
+				Email:   info.Email,
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,35 @@
+package providers
+
+import (
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+type larkUserInfo struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+func newLarkProvider(conf *viper.Viper) IdentityProvider {
+	return &oauth2Provider{
+		name: "lark",
+		conf: &oauth2.Config{
+			ClientID:     conf.GetString("client_id"),
+			ClientSecret: conf.GetString("client_secret"),
+			RedirectURL:  conf.GetString("redirect_uri"),
+			Scopes:       []string{"contact:user.email:readonly"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  "https://open.feishu.cn/open-apis/authen/v1/index",
+				TokenURL: "https://open.feishu.cn/open-apis/authen/v1/access_token",
+			},
+		},
+		userInfoURL: "https://open.feishu.cn/open-apis/authen/v1/user_info",
+		parse: func(body []byte) (*RemoteIdentity, error) {
+			var info larkUserInfo
+			if err := decodeJSON(body, &info); err != nil {
+				return nil, err
+			}
+			return &RemoteIdentity{Subject: info.UserID, Email: info.Email}, nil
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// userInfoParser extracts a RemoteIdentity out of a provider's raw
+// /userinfo response body, since every provider shapes that JSON
+// differently.
+type userInfoParser func(body []byte) (*RemoteIdentity, error)
+
+// oauth2Provider is a generic Authorization Code flow IdentityProvider for
+// providers that exchange the code for a standard OAuth2 JSON token
+// response and accept it as a Bearer header on /userinfo. Lark and GitHub
+// are thin configurations of this type; QQ and WeChat don't fit this
+// shape and implement IdentityProvider directly (see qq.go, wechat.go).
+type oauth2Provider struct {
+	name        string
+	conf        *oauth2.Config
+	userInfoURL string
+	parse       userInfoParser
+}
+
+func (p *oauth2Provider) Name() string {
+	return p.name
+}
+
+func (p *oauth2Provider) AuthCodeURL(state string) string {
+	return p.conf.AuthCodeURL(state)
+}
+
+func (p *oauth2Provider) Exchange(ctx context.Context, code string) (string, error) {
+	token, err := p.conf.Exchange(ctx, code)
+	if err != nil {
+		return "", fmt.Errorf("%s: exchange code: %w", p.name, err)
+	}
+	return token.AccessToken, nil
+}
+
+func (p *oauth2Provider) FetchUserInfo(ctx context.Context, accessToken string) (*RemoteIdentity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: fetch userinfo: %w", p.name, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: userinfo returned %d: %s", p.name, resp.StatusCode, body)
+	}
+
+	return p.parse(body)
+}
+
+// decodeJSON is a small helper the per-provider parse funcs share.
+func decodeJSON(body []byte, v interface{}) error {
+	return json.Unmarshal(body, v)
+}
+
+// httpGet is a small helper for the QQ/WeChat providers, which don't speak
+// the standard Authorization Code + Bearer-header shape oauth2Provider
+// implements and so build and parse their own requests.
+func httpGet(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %d: %s", rawURL, resp.StatusCode, body)
+	}
+	return body, nil
+}
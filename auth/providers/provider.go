@@ -0,0 +1,26 @@
+// Package providers implements the pluggable external identity providers
+// (Lark, GitHub, QQ, WeChat) that can be linked to a sast-link account.
+package providers
+
+import "context"
+
+// RemoteIdentity is the normalized subject returned by a provider's
+// /userinfo endpoint, already mapped to the fields we store on model.User.
+type RemoteIdentity struct {
+	// Subject is the provider's stable user identifier, stored in the
+	// matching model.User.*Id column (e.g. GithubId).
+	Subject string
+	Email   string
+}
+
+// IdentityProvider is implemented by every external identity provider we
+// support. Each provider drives a standard OAuth2 Authorization Code flow:
+// AuthCodeURL starts it, Exchange trades the callback code for a token,
+// and FetchUserInfo resolves that token to a RemoteIdentity.
+type IdentityProvider interface {
+	// Name is the provider key used in routes and config, e.g. "github".
+	Name() string
+	AuthCodeURL(state string) string
+	Exchange(ctx context.Context, code string) (accessToken string, err error)
+	FetchUserInfo(ctx context.Context, accessToken string) (*RemoteIdentity, error)
+}
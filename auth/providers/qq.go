@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/spf13/viper"
+)
+
+// jsonpWrapper matches QQ's "callback( {...} );" response shape. /oauth2.0/me
+// is requested with fmt=json to ask for a bare JSON body, but QQ doesn't
+// consistently honor that, so the wrapper is stripped defensively.
+var jsonpWrapper = regexp.MustCompile(`^\s*\w+\s*\(\s*(\{.*\})\s*\)\s*;?\s*$`)
+
+type qqTokenError struct {
+	Code int    `json:"error"`
+	Desc string `json:"error_description"`
+}
+
+type qqUserInfo struct {
+	ClientID string `json:"client_id"`
+	OpenID   string `json:"openid"`
+	Error    int    `json:"error"`
+	ErrMsg   string `json:"error_description"`
+}
+
+// qqProvider implements IdentityProvider against QQ Connect directly: the
+// token endpoint is a GET returning "access_token=...&..." form encoding
+// rather than JSON, and /oauth2.0/me identifies the caller from the access
+// token alone (QQ folds "exchange code" and "who is this" into endpoints
+// that don't fit oauth2Provider's Bearer-header shape).
+type qqProvider struct {
+	clientID, clientSecret, redirectURL string
+}
+
+func newQQProvider(conf *viper.Viper) IdentityProvider {
+	return &qqProvider{
+		clientID:     conf.GetString("client_id"),
+		clientSecret: conf.GetString("client_secret"),
+		redirectURL:  conf.GetString("redirect_uri"),
+	}
+}
+
+func (p *qqProvider) Name() string { return "qq" }
+
+func (p *qqProvider) AuthCodeURL(state string) string {
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.clientID},
+		"redirect_uri":  {p.redirectURL},
+		"state":         {state},
+	}
+	return "https://graph.qq.com/oauth2.0/authorize?" + q.Encode()
+}
+
+func (p *qqProvider) Exchange(ctx context.Context, code string) (string, error) {
+	q := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+	}
+	body, err := httpGet(ctx, "https://graph.qq.com/oauth2.0/token?"+q.Encode())
+	if err != nil {
+		return "", fmt.Errorf("qq: exchange code: %w", err)
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil || values.Get("access_token") == "" {
+		var tokenErr qqTokenError
+		if jsonErr := decodeJSON(stripJSONP(body), &tokenErr); jsonErr == nil && tokenErr.Code != 0 {
+			return "", fmt.Errorf("qq: exchange code: %d %s", tokenErr.Code, tokenErr.Desc)
+		}
+		return "", fmt.Errorf("qq: exchange code: unexpected token response: %s", body)
+	}
+	return values.Get("access_token"), nil
+}
+
+func (p *qqProvider) FetchUserInfo(ctx context.Context, accessToken string) (*RemoteIdentity, error) {
+	q := url.Values{"access_token": {accessToken}, "fmt": {"json"}}
+	body, err := httpGet(ctx, "https://graph.qq.com/oauth2.0/me?"+q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("qq: fetch openid: %w", err)
+	}
+
+	var info qqUserInfo
+	if err := decodeJSON(stripJSONP(body), &info); err != nil {
+		return nil, fmt.Errorf("qq: fetch openid: %w", err)
+	}
+	if info.Error != 0 {
+		return nil, fmt.Errorf("qq: fetch openid: %d %s", info.Error, info.ErrMsg)
+	}
+	if info.OpenID == "" {
+		return nil, fmt.Errorf("qq: fetch openid: empty openid in response")
+	}
+	// QQ doesn't hand out an email via this endpoint.
+	return &RemoteIdentity{Subject: info.OpenID}, nil
+}
+
+// stripJSONP unwraps QQ's "callback( {...} );" response format, if present,
+// so the inner object can be decoded as plain JSON.
+func stripJSONP(body []byte) []byte {
+	if m := jsonpWrapper.FindSubmatch(body); m != nil {
+		return m[1]
+	}
+	return body
+}
@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"fmt"
+
+	"github.com/NJUPT-SAST/sast-link-backend/config"
+)
+
+// ProviderRegistry holds the identity providers enabled via config, keyed
+// by their Name().
+type ProviderRegistry struct {
+	providers map[string]IdentityProvider
+}
+
+// NewProviderRegistry builds a ProviderRegistry from the `providers`
+// subtree of config, e.g.:
+//
+//	providers:
+//	  github:
+//	    enabled: true
+//	    client_id: ...
+//	    client_secret: ...
+//	    redirect_uri: https://sast.link/api/v1/oauth/github/callback
+func NewProviderRegistry() *ProviderRegistry {
+	reg := &ProviderRegistry{providers: map[string]IdentityProvider{}}
+
+	root := config.Config.Sub("providers")
+	if root == nil {
+		return reg
+	}
+
+	type builder struct {
+		name string
+		new  func() IdentityProvider
+	}
+	builders := []builder{
+		{"github", func() IdentityProvider { return newGithubProvider(root.Sub("github")) }},
+		{"lark", func() IdentityProvider { return newLarkProvider(root.Sub("lark")) }},
+		{"qq", func() IdentityProvider { return newQQProvider(root.Sub("qq")) }},
+		{"wechat", func() IdentityProvider { return newWechatProvider(root.Sub("wechat")) }},
+	}
+
+	for _, b := range builders {
+		conf := root.Sub(b.name)
+		if conf == nil || !conf.GetBool("enabled") {
+			continue
+		}
+		reg.providers[b.name] = b.new()
+	}
+
+	return reg
+}
+
+// Get returns the registered provider for name, or an error if it isn't
+// configured/enabled.
+func (r *ProviderRegistry) Get(name string) (IdentityProvider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("providers: %q is not configured", name)
+	}
+	return p, nil
+}
@@ -0,0 +1,18 @@
+// Command migratepasswords flags every account still storing a plaintext
+// password for a forced reset on next login, one-time cleanup for the
+// switch to argon2id hashing.
+package main
+
+import (
+	"log"
+
+	"github.com/NJUPT-SAST/sast-link-backend/model"
+)
+
+func main() {
+	migrated, err := model.MigrateLegacyPasswords()
+	if err != nil {
+		log.Fatalf("migratepasswords: %v", err)
+	}
+	log.Printf("migratepasswords: flagged %d account(s) with a plaintext password for forced reset", migrated)
+}
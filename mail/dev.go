@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NJUPT-SAST/sast-link-backend/config"
+)
+
+// devMailer writes rendered messages to disk instead of sending them,
+// for local development and CI where there's no SMTP credentials to use.
+type devMailer struct {
+	dir string
+}
+
+func newDevMailer() *devMailer {
+	dir := config.Config.Sub("email").GetString("dev_dir")
+	if dir == "" {
+		dir = "tmp/mail"
+	}
+	return &devMailer{dir: dir}
+}
+
+func (m *devMailer) SendTemplate(ctx context.Context, to string, templateName string, data interface{}) error {
+	msg, err := render(templateName, data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("mail: dev backend: %w", err)
+	}
+
+	name := fmt.Sprintf("%d-%s-%s.eml", time.Now().UnixNano(), templateName, to)
+	path := filepath.Join(m.dir, name)
+
+	body, err := buildMIMEMessage("dev@sast.link", to, msg)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, body, 0o644)
+}
@@ -0,0 +1,38 @@
+// Package mail renders and sends the transactional emails sast-link
+// sends to users, replacing the ad-hoc model.SendEmail.
+//
+// mail/templates holds a single template set, "verify-email", sent from
+// model.GenerateVerifyCode. There are no templates for password reset,
+// account deletion or OAuth client approval.
+package mail
+
+import (
+	"context"
+	"sync"
+
+	"github.com/NJUPT-SAST/sast-link-backend/config"
+)
+
+// Mailer sends a named template, rendered with data, to to.
+type Mailer interface {
+	SendTemplate(ctx context.Context, to string, templateName string, data interface{}) error
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultMailer Mailer
+)
+
+// Default returns the process-wide Mailer. The backend is selected via
+// `email.backend` in config: "dev" writes rendered messages to disk
+// instead of sending them, anything else (including unset) uses SMTP.
+func Default() Mailer {
+	defaultOnce.Do(func() {
+		if config.Config.Sub("email").GetString("backend") == "dev" {
+			defaultMailer = newDevMailer()
+		} else {
+			defaultMailer = newSMTPMailer()
+		}
+	})
+	return defaultMailer
+}
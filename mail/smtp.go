@@ -0,0 +1,213 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+
+	"github.com/NJUPT-SAST/sast-link-backend/config"
+)
+
+// poolSize bounds how many SMTP connections smtpMailer keeps warm. It's
+// intentionally small: transactional mail here is low-volume.
+const poolSize = 4
+
+const maxRetries = 2
+
+// smtpMailer sends rendered templates over SMTP, reusing a small pool of
+// already-authenticated connections instead of dialing fresh TLS on every
+// send.
+type smtpMailer struct {
+	host     string
+	port     string
+	sender   string
+	username string
+	secret   string
+	implicit bool // true: TLS from the first byte (port 465); false: STARTTLS
+
+	pool chan *smtp.Client
+}
+
+func newSMTPMailer() *smtpMailer {
+	emailConf := config.Config.Sub("email")
+	host := emailConf.GetString("host")
+	port := emailConf.GetString("port")
+	if port == "" {
+		port = "465"
+	}
+	username := emailConf.GetString("username")
+	sender := emailConf.GetString("sender")
+	if username == "" {
+		username = sender
+	}
+
+	return &smtpMailer{
+		host:     host,
+		port:     port,
+		sender:   sender,
+		username: username,
+		secret:   emailConf.GetString("secret"),
+		implicit: port == "465",
+		pool:     make(chan *smtp.Client, poolSize),
+	}
+}
+
+func (m *smtpMailer) SendTemplate(ctx context.Context, to string, templateName string, data interface{}) error {
+	msg, err := render(templateName, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := buildMIMEMessage(m.sender, to, msg)
+	if err != nil {
+		return err
+	}
+
+	var sendErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		client, err := m.acquire()
+		if err != nil {
+			sendErr = err
+			continue
+		}
+
+		sendErr = m.deliver(client, to, body)
+		if sendErr == nil {
+			m.release(client)
+			return nil
+		}
+		// A connection that failed mid-send is probably dead; don't
+		// return it to the pool.
+		_ = client.Close()
+	}
+	return fmt.Errorf("mail: send to %s failed after %d attempt(s): %w", to, maxRetries+1, sendErr)
+}
+
+// acquire pulls a live connection from the pool, verifying it with NOOP,
+// or dials a fresh one.
+func (m *smtpMailer) acquire() (*smtp.Client, error) {
+	select {
+	case client := <-m.pool:
+		if client.Noop() == nil {
+			return client, nil
+		}
+		_ = client.Close()
+	default:
+	}
+	return m.dial()
+}
+
+// release returns a connection to the pool for reuse, closing it instead
+// if the pool is already full.
+func (m *smtpMailer) release(client *smtp.Client) {
+	select {
+	case m.pool <- client:
+	default:
+		_ = client.Close()
+	}
+}
+
+func (m *smtpMailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.host, m.port)
+
+	var conn net.Conn
+	var err error
+	if m.implicit {
+		conn, err = tls.Dial("tcp", addr, &tls.Config{ServerName: m.host})
+	} else {
+		conn, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mail: dial %s: %w", addr, err)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return nil, fmt.Errorf("mail: new client: %w", err)
+	}
+
+	if !m.implicit {
+		// Fail closed: a server (or an on-path attacker) that doesn't
+		// advertise STARTTLS must not fall through to sending auth
+		// credentials and the message body in the clear.
+		ok, _ := client.Extension("STARTTLS")
+		if !ok {
+			_ = client.Close()
+			return nil, fmt.Errorf("mail: starttls: server does not advertise STARTTLS")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return nil, fmt.Errorf("mail: starttls: %w", err)
+		}
+	}
+
+	if m.secret != "" {
+		auth := smtp.PlainAuth("", m.username, m.secret, m.host)
+		if err := client.Auth(auth); err != nil {
+			return nil, fmt.Errorf("mail: auth: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+func (m *smtpMailer) deliver(client *smtp.Client, to string, body []byte) error {
+	if err := client.Mail(m.sender); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// buildMIMEMessage renders msg as a multipart/alternative email (falling
+// back to text-only if there's no HTML variant).
+func buildMIMEMessage(from string, to string, msg *rendered) ([]byte, error) {
+	boundary := fmt.Sprintf("sast-link-%d", time.Now().UnixNano())
+
+	headers := make(map[string]string)
+	headers["From"] = (&mail.Address{Address: from}).String()
+	headers["To"] = (&mail.Address{Address: to}).String()
+	headers["Subject"] = mime.QEncoding.Encode("UTF-8", msg.subject)
+	headers["MIME-Version"] = "1.0"
+
+	var buf bytes.Buffer
+	if msg.html == "" {
+		headers["Content-Type"] = "text/plain; charset=UTF-8"
+		writeHeaders(&buf, headers)
+		buf.WriteString(msg.text)
+		return buf.Bytes(), nil
+	}
+
+	headers["Content-Type"] = fmt.Sprintf("multipart/alternative; boundary=%q", boundary)
+	writeHeaders(&buf, headers)
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(msg.text + "\r\n\r\n")
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	buf.WriteString(msg.html + "\r\n\r\n")
+	buf.WriteString("--" + boundary + "--\r\n")
+
+	return buf.Bytes(), nil
+}
+
+func writeHeaders(buf *bytes.Buffer, headers map[string]string) {
+	for k, v := range headers {
+		fmt.Fprintf(buf, "%s: %s\r\n", k, v)
+	}
+	buf.WriteString("\r\n")
+}
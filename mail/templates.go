@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"sync"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// rendered is a fully rendered, ready-to-send template.
+type rendered struct {
+	subject string
+	text    string
+	html    string
+}
+
+var (
+	parseOnce sync.Once
+	textTmpl  *texttemplate.Template
+	htmlTmpl  *htmltemplate.Template
+	parseErr  error
+)
+
+func parseTemplates() {
+	parseOnce.Do(func() {
+		textTmpl, parseErr = texttemplate.ParseFS(templateFS, "templates/*.subject.tmpl", "templates/*.txt.tmpl")
+		if parseErr != nil {
+			return
+		}
+		htmlTmpl, parseErr = htmltemplate.ParseFS(templateFS, "templates/*.html.tmpl")
+	})
+}
+
+// render executes the subject/text/html templates for name against data.
+// A template is missing its html variant is fine (e.g. plain-text-only
+// notices); a missing subject or text variant is not.
+func render(name string, data interface{}) (*rendered, error) {
+	parseTemplates()
+	if parseErr != nil {
+		return nil, fmt.Errorf("mail: parsing templates: %w", parseErr)
+	}
+
+	var subjectBuf, textBuf, htmlBuf bytes.Buffer
+
+	if err := textTmpl.ExecuteTemplate(&subjectBuf, name+".subject.tmpl", data); err != nil {
+		return nil, fmt.Errorf("mail: rendering %s subject: %w", name, err)
+	}
+	if err := textTmpl.ExecuteTemplate(&textBuf, name+".txt.tmpl", data); err != nil {
+		return nil, fmt.Errorf("mail: rendering %s text body: %w", name, err)
+	}
+	if htmlTmpl.Lookup(name+".html.tmpl") != nil {
+		if err := htmlTmpl.ExecuteTemplate(&htmlBuf, name+".html.tmpl", data); err != nil {
+			return nil, fmt.Errorf("mail: rendering %s html body: %w", name, err)
+		}
+	}
+
+	return &rendered{
+		subject: subjectBuf.String(),
+		text:    textBuf.String(),
+		html:    htmlBuf.String(),
+	}, nil
+}
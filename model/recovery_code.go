@@ -0,0 +1,68 @@
+package model
+
+import (
+	"time"
+
+	"github.com/NJUPT-SAST/sast-link-backend/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RecoveryCode is a single-use backup code a user can redeem in place of a
+// TOTP code if they lose access to their authenticator app.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	Uid       string `gorm:"index;not null"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "user_recovery_codes"
+}
+
+// GenerateRecoveryCodes replaces uid's recovery codes with n freshly
+// generated ones and returns the plaintext codes, which are shown to the
+// user exactly once - only their bcrypt hash is persisted.
+func GenerateRecoveryCodes(uid string, n int) ([]string, error) {
+	if err := Db.Where("uid = ?", uid).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, n)
+	rows := make([]RecoveryCode, 0, n)
+	for i := 0; i < n; i++ {
+		code, err := util.GenerateRandomString(10)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		rows = append(rows, RecoveryCode{Uid: uid, CodeHash: string(hash), CreatedAt: time.Now()})
+	}
+
+	if err := Db.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ConsumeRecoveryCode marks the first unused recovery code matching code
+// as used and reports whether one matched.
+func ConsumeRecoveryCode(uid string, code string) (bool, error) {
+	var rows []RecoveryCode
+	if err := Db.Where("uid = ? AND used_at IS NULL", uid).Find(&rows).Error; err != nil {
+		return false, err
+	}
+
+	for _, row := range rows {
+		if bcrypt.CompareHashAndPassword([]byte(row.CodeHash), []byte(code)) == nil {
+			now := time.Now()
+			return true, Db.Model(&row).Update("used_at", now).Error
+		}
+	}
+	return false, nil
+}
@@ -2,16 +2,14 @@ package model
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
-	"net"
-	"net/mail"
-	"net/smtp"
 	"regexp"
 	"time"
 
 	"github.com/NJUPT-SAST/sast-link-backend/log"
+	"github.com/NJUPT-SAST/sast-link-backend/mail"
+	"github.com/NJUPT-SAST/sast-link-backend/password"
 	"github.com/NJUPT-SAST/sast-link-backend/util"
 	"gorm.io/gorm"
 )
@@ -30,16 +28,28 @@ type User struct {
 	WechatId  *string   `json:"wechat_id,omitempty"`
 	CreatedAt time.Time `json:"created_at,omitempty" gorm:"not null"`
 	IsDeleted bool      `json:"is_deleted,omitempty" gorm:"not null"`
+
+	// TOTPSecret is the encrypted (otp.Encrypt) base32 TOTP secret. It's
+	// set on enroll and only considered active once TOTPConfirmedAt is.
+	TOTPSecret      *string    `json:"-" gorm:"column:totp_secret"`
+	TOTPConfirmedAt *time.Time `json:"totp_confirmed_at,omitempty" gorm:"column:totp_confirmed_at"`
 }
 
 func CreateUser(user *User) error {
+	if user.Password != nil && !password.IsHashed(*user.Password) {
+		hash, err := password.Hash(*user.Password)
+		if err != nil {
+			return err
+		}
+		user.Password = &hash
+	}
 	if res := Db.Create(user); res.Error != nil {
 		return res.Error
 	}
 	return nil
 }
 
-func CheckPassword(username string, password string) (bool, error) {
+func CheckPassword(username string, plain string) (bool, error) {
 	var user User
 	matched, err2 := regexp.MatchString("@", username)
 	if err2 != nil {
@@ -59,8 +69,29 @@ func CheckPassword(username string, password string) (bool, error) {
 			exist = false
 		}
 	}
-	if *user.Password != password {
+	if user.Password == nil || !password.IsHashed(*user.Password) {
+		// Legacy plaintext rows are rejected here. If MigrateLegacyPasswords
+		// already flagged this account, surface that distinctly instead of
+		// a bare false the caller can't tell apart from "wrong password".
+		if user.Uid != nil {
+			if flagged, fErr := Rdb.Exists(ctx, ForceResetKey(*user.Uid)).Result(); fErr == nil && flagged > 0 {
+				return false, ErrForceResetRequired
+			}
+		}
+		return false, err
+	}
+
+	matches, needsRehash, vErr := password.Verify(*user.Password, plain)
+	if vErr != nil {
+		userLogger.Infof("password verify error for user [%s]: %v", username, vErr)
+		return false, vErr
+	}
+	if !matches {
 		exist = false
+	} else if needsRehash {
+		if newHash, hErr := password.Hash(plain); hErr == nil {
+			Db.Model(&user).Update("password", newHash)
+		}
 	}
 	return exist, err
 }
@@ -101,92 +132,163 @@ func UserInfo(username string) (*User, error) {
 	return &user, nil
 }
 
-func GenerateVerifyCode(username string) string {
-	code := util.GenerateCode()
-	// 5min expire
-	Rdb.Set(ctx, "VERIFY_CODE:"+username, code, time.Minute*5)
-	return code
+// providerColumn maps an external identity provider name to the User
+// column that stores the linked remote subject.
+func providerColumn(provider string) (string, error) {
+	switch provider {
+	case "qq":
+		return "qq_id", nil
+	case "lark":
+		return "lark_id", nil
+	case "github":
+		return "github_id", nil
+	case "wechat":
+		return "wechat_id", nil
+	default:
+		return "", fmt.Errorf("model: unknown identity provider %q", provider)
+	}
 }
 
-func SendEmail(recipient string, content string) error {
-	// https://gist.github.com/chrisgillis/10888032
-	emailInfo := conf.Sub("email")
-	sender := emailInfo.GetString("sender")
-	secret := emailInfo.GetString("secret")
-	from := mail.Address{"", sender}
-	to := mail.Address{"", recipient}
-	subj := "确认电子邮件注册SAST-Link账户"
-	body := content
-
-	// Setup headers
-	headers := make(map[string]string)
-	headers["From"] = from.String()
-	headers["To"] = to.String()
-	headers["Subject"] = subj
-
-	// setup message
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+// FindByProviderID looks up the user linked to the given provider's remote
+// subject, e.g. FindByProviderID("github", "123456").
+func FindByProviderID(provider string, subject string) (*User, error) {
+	column, err := providerColumn(provider)
+	if err != nil {
+		return nil, err
 	}
-	message += "\r\n" + body
-
-	// Connect to the SMTP server
-	servername := "smtp.feishu.cn:465"
-
-	host, _, _ := net.SplitHostPort(servername)
-
-	auth := smtp.PlainAuth("", sender, secret, host)
 
-	// TLS config
-	tlsconfig := &tls.Config{
-		InsecureSkipVerify: true,
-		ServerName:         host,
+	var user User
+	if err := Db.Where(column+" = ?", subject).First(&user).Error; err != nil {
+		return nil, err
 	}
+	return &user, nil
+}
 
-	// Here is the key, you need to call tls.Dial instead of smtp.Dial
-	// for smtp servers running on 465 that require an ssl connection
-	// from the very beginning (no starttls)
-	conn, err := tls.Dial("tcp", servername, tlsconfig)
-	if err != nil {
-		return err
-	}
+// ErrIdentityAlreadyLinked is returned by LinkIdentity when the remote
+// subject is already linked to a different account, so two accounts can
+// never resolve to the same provider identity and become ambiguous to
+// FindByProviderID.
+var ErrIdentityAlreadyLinked = errors.New("model: identity already linked to another account")
 
-	c, err := smtp.NewClient(conn, host)
+// LinkIdentity attaches an external provider's remote subject to an
+// already-registered account.
+func LinkIdentity(uid string, provider string, subject string) error {
+	column, err := providerColumn(provider)
 	if err != nil {
 		return err
 	}
 
-	// Auth
-	if err = c.Auth(auth); err != nil {
+	existing, err := FindByProviderID(provider, subject)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return err
 	}
-
-	// To && From
-	if err = c.Mail(from.Address); err != nil {
-		return err
+	if existing != nil && existing.Uid != nil && *existing.Uid != uid {
+		return ErrIdentityAlreadyLinked
 	}
 
-	if err = c.Rcpt(to.Address); err != nil {
-		return err
-	}
+	return Db.Model(&User{}).Where("uid = ?", uid).Update(column, subject).Error
+}
 
-	// Data
-	w, err := c.Data()
+// UnlinkIdentity removes a previously linked external provider from an
+// account.
+func UnlinkIdentity(uid string, provider string) error {
+	column, err := providerColumn(provider)
 	if err != nil {
 		return err
 	}
 
-	_, err = w.Write([]byte(message))
+	return Db.Model(&User{}).Where("uid = ?", uid).Update(column, nil).Error
+}
+
+// SetTOTPSecret stores an encrypted, not-yet-confirmed TOTP secret for
+// uid. It only takes effect once ConfirmTOTP is called.
+func SetTOTPSecret(uid string, encryptedSecret string) error {
+	return Db.Model(&User{}).Where("uid = ?", uid).Update("totp_secret", encryptedSecret).Error
+}
+
+// ConfirmTOTP marks the pending TOTP secret set by SetTOTPSecret as
+// active.
+func ConfirmTOTP(uid string) error {
+	now := time.Now()
+	return Db.Model(&User{}).Where("uid = ?", uid).Update("totp_confirmed_at", &now).Error
+}
+
+// DisableTOTP removes a user's TOTP secret and confirmation, turning
+// second-factor login back off.
+func DisableTOTP(uid string) error {
+	return Db.Model(&User{}).Where("uid = ?", uid).Updates(map[string]interface{}{
+		"totp_secret":       nil,
+		"totp_confirmed_at": nil,
+	}).Error
+}
+
+// HasTOTPEnabled reports whether uid has a confirmed TOTP secret.
+func HasTOTPEnabled(uid string) (bool, error) {
+	user, err := UserInfo(uid)
 	if err != nil {
-		return err
+		return false, err
 	}
+	return user.TOTPSecret != nil && user.TOTPConfirmedAt != nil, nil
+}
 
-	err = w.Close()
-	if err != nil {
-		return err
+// OtpPassedKey is the short-lived Redis marker userAuthorizeHandler looks
+// for to know a pending /authorize request already cleared OTP
+// verification via v1.OauthOtpVerify.
+func OtpPassedKey(username string) string {
+	return "OTP_PASSED:" + username
+}
+
+// ForceResetKey is the Redis key holding the "must reset password" flag
+// MigrateLegacyPasswords sets for accounts that still have a plaintext
+// password, mirroring the naming used by LoginTokenKey.
+func ForceResetKey(username string) string {
+	return "FORCE_RESET:" + username
+}
+
+// ErrForceResetRequired is returned by CheckPassword instead of a bare
+// false for accounts MigrateLegacyPasswords flagged via ForceResetKey, so
+// the caller can tell "must reset password" apart from "wrong password"
+// with errors.Is and route the user to a reset flow instead of a generic
+// login failure.
+var ErrForceResetRequired = errors.New("model: password reset required")
+
+// MigrateLegacyPasswords scans every user for a plaintext (non PHC-encoded)
+// password and flags them in Redis for a forced reset on next login,
+// instead of migrating the plaintext value directly (we don't want to
+// persist a hash of a password we can no longer trust wasn't compromised
+// while it sat in cleartext).
+func MigrateLegacyPasswords() (migrated int, err error) {
+	var users []User
+	if err := Db.Find(&users).Error; err != nil {
+		return 0, err
 	}
 
-	c.Quit()
-	return nil
+	for _, user := range users {
+		if user.Uid == nil || user.Password == nil || password.IsHashed(*user.Password) {
+			continue
+		}
+		if err := Rdb.Set(ctx, ForceResetKey(*user.Uid), "1", 0).Err(); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// GenerateVerifyCode issues a fresh email verification code for username,
+// stores it for the same 5min window it always has, and sends it via the
+// "verify-email" template instead of making the caller build the message
+// body itself.
+func GenerateVerifyCode(username string) string {
+	code := util.GenerateCode()
+	// 5min expire
+	Rdb.Set(ctx, "VERIFY_CODE:"+username, code, time.Minute*5)
+
+	if err := mail.Default().SendTemplate(ctx, username, "verify-email", map[string]interface{}{
+		"Code": code,
+	}); err != nil {
+		userLogger.Infof("failed to send verify-email to [%s]: %v", username, err)
+	}
+
+	return code
 }
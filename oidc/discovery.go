@@ -0,0 +1,28 @@
+package oidc
+
+import "github.com/NJUPT-SAST/sast-link-backend/config"
+
+// Discovery returns the OpenID Provider Configuration document served at
+// /.well-known/openid-configuration (OpenID Connect Discovery 1.0).
+func Discovery() map[string]interface{} {
+	issuer := Issuer()
+	// Same rule InitServer applies: "plain" only when oauth.pkce_allow_plain is set.
+	challengeMethods := []string{"S256"}
+	if config.Config.Sub("oauth").GetBool("pkce_allow_plain") {
+		challengeMethods = append(challengeMethods, "plain")
+	}
+	return map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/api/v1/oauth/authorize",
+		"token_endpoint":                        issuer + "/api/v1/oauth/token",
+		"userinfo_endpoint":                     issuer + "/api/v1/oauth/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"scopes_supported":                      []string{"openid", "profile", "email", "groups"},
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_post", "none"},
+		"code_challenge_methods_supported":      challengeMethods,
+	}
+}
@@ -0,0 +1,116 @@
+package oidc
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/NJUPT-SAST/sast-link-backend/config"
+)
+
+// JWKSStore exposes the signing key(s) used to issue ID tokens, and the
+// public half of those keys rendered as a JWKS document for the
+// /.well-known/jwks.json endpoint.
+type JWKSStore interface {
+	// ActiveKey returns the kid and private key currently used to sign
+	// new ID tokens.
+	ActiveKey() (kid string, key *rsa.PrivateKey, err error)
+	// JWKS returns the public keys as an RFC 7517 JWK Set: a "keys" list
+	// whose entries each carry their kid.
+	JWKS() (map[string]interface{}, error)
+}
+
+// configJWKSStore loads a single RSA signing key from the `oauth.oidc`
+// config tree (PEM, base64-encoded). It's kept in memory for the lifetime
+// of the process; key rotation is out of scope for now.
+type configJWKSStore struct {
+	once sync.Once
+	kid  string
+	key  *rsa.PrivateKey
+	err  error
+}
+
+var defaultJWKSStore = &configJWKSStore{}
+
+// DefaultJWKSStore returns the process-wide JWKSStore backed by config.
+func DefaultJWKSStore() JWKSStore {
+	return defaultJWKSStore
+}
+
+func (s *configJWKSStore) load() {
+	s.once.Do(func() {
+		oidcConf := config.Config.Sub("oauth").Sub("oidc")
+		if oidcConf == nil {
+			s.err = fmt.Errorf("oidc: missing oauth.oidc config section")
+			return
+		}
+		kid := oidcConf.GetString("kid")
+		if kid == "" {
+			kid = "default"
+		}
+		encoded := oidcConf.GetString("signing_key")
+		if encoded == "" {
+			s.err = fmt.Errorf("oidc: oauth.oidc.signing_key not configured")
+			return
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			// Allow the key to be configured as a raw PEM block too.
+			raw = []byte(encoded)
+		}
+
+		block, _ := pem.Decode(raw)
+		if block == nil {
+			s.err = fmt.Errorf("oidc: signing_key is not valid PEM")
+			return
+		}
+
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			pkcs8Key, err2 := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err2 != nil {
+				s.err = fmt.Errorf("oidc: failed to parse signing_key: %w", err)
+				return
+			}
+			rsaKey, ok := pkcs8Key.(*rsa.PrivateKey)
+			if !ok {
+				s.err = fmt.Errorf("oidc: signing_key is not an RSA key")
+				return
+			}
+			key = rsaKey
+		}
+
+		s.kid = kid
+		s.key = key
+	})
+}
+
+func (s *configJWKSStore) ActiveKey() (string, *rsa.PrivateKey, error) {
+	s.load()
+	return s.kid, s.key, s.err
+}
+
+func (s *configJWKSStore) JWKS() (map[string]interface{}, error) {
+	kid, key, err := s.ActiveKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"keys": []map[string]interface{}{
+			{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			},
+		},
+	}, nil
+}
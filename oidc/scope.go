@@ -0,0 +1,83 @@
+package oidc
+
+import (
+	"strings"
+
+	"github.com/NJUPT-SAST/sast-link-backend/model"
+)
+
+// ScopeClaims maps an OIDC scope to the set of UserInfo/ID token claims it
+// unlocks. Mirrors the scope -> claim mapping used by most OIDC providers
+// (and the approach taken by the tulip/lavender projects): "openid" is
+// always required and only grants "sub", the rest are additive.
+var ScopeClaims = map[string][]string{
+	"openid":  {"sub"},
+	"profile": {"uid"},
+	"email":   {"email"},
+	"groups":  {"lark_id", "github_id", "qq_id", "wechat_id"},
+}
+
+// ParseScope splits an OAuth2 scope string ("openid profile email") into
+// its individual scope tokens.
+func ParseScope(scope string) []string {
+	if scope == "" {
+		return nil
+	}
+	return strings.Fields(scope)
+}
+
+// ClaimsForUser builds the claim set a token with the given granted scopes
+// is allowed to see for user. Unknown scopes are ignored so that adding a
+// custom scope never leaks unrelated fields.
+func ClaimsForUser(user *model.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{}
+	if user.Uid != nil {
+		claims["sub"] = *user.Uid
+	}
+
+	for _, scope := range scopes {
+		fields, ok := ScopeClaims[scope]
+		if !ok {
+			continue
+		}
+		for _, field := range fields {
+			switch field {
+			case "uid":
+				if user.Uid != nil {
+					claims["uid"] = *user.Uid
+				}
+			case "email":
+				if user.Email != nil {
+					claims["email"] = *user.Email
+				}
+			case "lark_id":
+				if user.LarkId != nil {
+					claims["lark_id"] = *user.LarkId
+				}
+			case "github_id":
+				if user.GithubId != nil {
+					claims["github_id"] = *user.GithubId
+				}
+			case "qq_id":
+				if user.QQId != nil {
+					claims["qq_id"] = *user.QQId
+				}
+			case "wechat_id":
+				if user.WechatId != nil {
+					claims["wechat_id"] = *user.WechatId
+				}
+			}
+		}
+	}
+	return claims
+}
+
+// HasScope reports whether scopes contains target.
+func HasScope(scopes []string, target string) bool {
+	for _, s := range scopes {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+// Package password hashes and verifies user passwords with argon2id,
+// replacing the plaintext comparisons model.CheckPassword used to do.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/NJUPT-SAST/sast-link-backend/config"
+	"golang.org/x/crypto/argon2"
+)
+
+const phcPrefix = "$argon2id$"
+
+// Params controls the cost of a new hash. Values come from the
+// `password.argon2` config tree so they can be tuned per-deployment
+// without a code change; hardening them later doesn't invalidate hashes
+// created under weaker params, see Verify's needsRehash return.
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// currentParams returns the params new hashes should be created with.
+func currentParams() Params {
+	p := Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+
+	argon2Conf := config.Config.Sub("password").Sub("argon2")
+	if argon2Conf == nil {
+		return p
+	}
+	if v := argon2Conf.GetInt("memory_kib"); v > 0 {
+		p.Memory = uint32(v)
+	}
+	if v := argon2Conf.GetInt("iterations"); v > 0 {
+		p.Iterations = uint32(v)
+	}
+	if v := argon2Conf.GetInt("parallelism"); v > 0 {
+		p.Parallelism = uint8(v)
+	}
+	return p
+}
+
+// pepper is a secret shared across all hashes, kept out of the database so
+// a leaked DB dump alone isn't enough to brute-force passwords offline.
+func pepper() string {
+	return config.Config.Sub("password").GetString("pepper")
+}
+
+// IsHashed reports whether s looks like one of our PHC-formatted hashes,
+// as opposed to a legacy plaintext password.
+func IsHashed(s string) bool {
+	return strings.HasPrefix(s, phcPrefix)
+}
+
+// Hash derives a PHC-formatted argon2id hash for plain, using the
+// currently configured params and pepper:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func Hash(plain string) (string, error) {
+	p := currentParams()
+
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("password: generate salt: %w", err)
+	}
+
+	hash := argon2.IDKey([]byte(pepper()+plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+// Verify checks plain against hash. needsRehash reports whether hash was
+// produced with weaker params than currentParams(), so the caller can
+// transparently re-hash the password with Hash on a successful login.
+func Verify(hash string, plain string) (matches bool, needsRehash bool, err error) {
+	p, salt, key, err := decode(hash)
+	if err != nil {
+		return false, false, err
+	}
+
+	candidate := argon2.IDKey([]byte(pepper()+plain), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+	matches = subtle.ConstantTimeCompare(candidate, key) == 1
+
+	current := currentParams()
+	needsRehash = p.Memory < current.Memory || p.Iterations < current.Iterations || p.Parallelism < current.Parallelism
+
+	return matches, needsRehash, nil
+}
+
+func decode(hash string) (Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	// ["", "argon2id", "v=19", "m=...,t=...,p=...", "<salt>", "<hash>"]
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Params{}, nil, nil, fmt.Errorf("password: not a recognized argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Params{}, nil, nil, fmt.Errorf("password: malformed version segment: %w", err)
+	}
+	if version != argon2.Version {
+		return Params{}, nil, nil, fmt.Errorf("password: unsupported argon2 version %d", version)
+	}
+
+	var p Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Params{}, nil, nil, fmt.Errorf("password: malformed params segment: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("password: malformed salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("password: malformed hash: %w", err)
+	}
+
+	return p, salt, key, nil
+}
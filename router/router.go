@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	v1 "github.com/NJUPT-SAST/sast-link-backend/api/v1"
+	"github.com/NJUPT-SAST/sast-link-backend/apierror"
 	"github.com/gin-gonic/gin"
 )
 
@@ -24,8 +25,36 @@ func InitRouter() *gin.Engine {
 	usergroup := apiV1.Group("/user")
 	{
 		usergroup.POST("/register", v1.Register)
+		usergroup.POST("/identity/:provider/link", apierror.Handle(v1.IdentityLink))
+		usergroup.POST("/identity/:provider/unlink", apierror.Handle(v1.IdentityUnlink))
 	}
 
+	otpgroup := usergroup.Group("/otp")
+	{
+		otpgroup.POST("/enroll", apierror.Handle(v1.OtpEnroll))
+		otpgroup.POST("/confirm", apierror.Handle(v1.OtpConfirm))
+		otpgroup.POST("/disable", apierror.Handle(v1.OtpDisable))
+		otpgroup.POST("/recovery_codes", apierror.Handle(v1.OtpRegenerateRecoveryCodes))
+	}
+
+	oauthgroup := apiV1.Group("/oauth")
+	{
+		oauthgroup.GET("/userinfo", apierror.Handle(v1.OauthUserInfo))
+		oauthgroup.GET("/:provider/login", apierror.Handle(v1.IdentityLogin))
+		oauthgroup.GET("/:provider/callback", apierror.Handle(v1.IdentityCallback))
+		oauthgroup.POST("/otp_verify", apierror.Handle(v1.OauthOtpVerify))
+
+		// Matches the authorization_endpoint/token_endpoint oidc.Discovery
+		// advertises at /.well-known/openid-configuration.
+		oauthgroup.GET("/authorize", apierror.Handle(v1.Authorize))
+		oauthgroup.POST("/authorize", apierror.Handle(v1.Authorize))
+		oauthgroup.POST("/token", apierror.Handle(v1.AccessToken))
+		oauthgroup.POST("/refresh_token", apierror.Handle(v1.RefreshToken))
+	}
+
+	r.GET("/.well-known/openid-configuration", apierror.Handle(v1.Discovery))
+	r.GET("/.well-known/jwks.json", apierror.Handle(v1.JWKS))
+
 	// admingroup := apiV1.Group("/admin")
 	// {
 	// }